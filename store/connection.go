@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -23,10 +24,50 @@ type Connection struct {
 
 	txStateMu   sync.Mutex
 	txStartedAt time.Time
+	activeTxn   *Txn // Non-nil if an explicit transaction, started via Begin, is in progress.
+
+	// closemu guards against a statement landing on the underlying SQLite
+	// connection while a rollback is in progress, which would otherwise let
+	// SQLite silently start (and auto-commit) a new implicit transaction
+	// concurrently with the ROLLBACK. Execute, Query, and ExecuteOrAbort take
+	// the R-lock for the duration of the call; AbortTransaction and Close
+	// take the W-lock before rolling back, mirroring how database/sql guards
+	// tx.closemu around Tx.rollback. Unlike database/sql's per-Tx closemu,
+	// this one lives on the Connection, so it must not outlive a single
+	// rollback: only closed is a permanent, terminal flag. A rollback does
+	// not stop the Connection itself from being reused for new statements or
+	// new explicit transactions -- only the specific Txn whose transaction
+	// was rolled out from under it is done, which Txn.checkActive detects
+	// via activeTxn/transactionActive(), not via anything stored here.
+	closemu sync.RWMutex
+	closed  bool
+
+	// txActiveHook, if non-nil, is called instead of db.TransactionActive().
+	// It exists purely so tests can drive Txn/TxStateChange logic without a
+	// real SQLite connection.
+	txActiveHook func() bool
 
 	logger *log.Logger
 }
 
+// transactionActive reports whether a transaction is currently active on
+// the underlying SQLite connection.
+func (c *Connection) transactionActive() bool {
+	if c.txActiveHook != nil {
+		return c.txActiveHook()
+	}
+	return c.db.TransactionActive()
+}
+
+// touch records that the connection is being used right now, so the idle
+// reaper can tell it apart from a connection a client opened and forgot
+// about.
+func (c *Connection) touch() {
+	c.timeMu.Lock()
+	c.lastUsedAt = time.Now()
+	c.timeMu.Unlock()
+}
+
 // NewConnection returns a connection to the database.
 func NewConnection(c *sdb.Conn, s *Store, id uint64) *Connection {
 	return &Connection{
@@ -50,18 +91,107 @@ func (c *Connection) String() string {
 
 // Execute executes queries that return no rows, but do modify the database.
 func (c *Connection) Execute(ex *ExecuteRequest) (*ExecuteResponse, error) {
-	return c.store.execute(c, ex)
+	return c.ExecuteContext(context.Background(), ex)
+}
+
+// ExecuteContext is like Execute but honors the cancellation and deadline of
+// ctx. If ctx is canceled or its deadline expires while the statement is in
+// flight, the underlying SQLite connection is interrupted so the statement
+// returns promptly instead of running to completion.
+func (c *Connection) ExecuteContext(ctx context.Context, ex *ExecuteRequest) (*ExecuteResponse, error) {
+	c.closemu.RLock()
+	defer c.closemu.RUnlock()
+	if c.closed {
+		return nil, ErrTxDone
+	}
+	c.touch()
+
+	stop := c.watchContext(ctx)
+	defer stop()
+
+	// Captured before the call so CheckAndSet can detect whether the
+	// statement was interrupted mid-transaction; snapshotting it after the
+	// call would just observe the post-interrupt state and never fire.
+	tsc := NewTxStateChange(c)
+	resp, err := c.store.executeContext(ctx, c, ex)
+	if err != nil && ctx.Err() != nil {
+		tsc.CheckAndSet()
+	}
+	return resp, err
 }
 
 // ExecuteOrAbort executes the requests, but aborts any active transaction
 // on the underlying database in the case of any error.
 func (c *Connection) ExecuteOrAbort(ex *ExecuteRequest) (resp *ExecuteResponse, retErr error) {
-	return c.store.executeOrAbort(c, ex)
+	return c.ExecuteOrAbortContext(context.Background(), ex)
+}
+
+// ExecuteOrAbortContext is like ExecuteOrAbort but honors the cancellation
+// and deadline of ctx.
+func (c *Connection) ExecuteOrAbortContext(ctx context.Context, ex *ExecuteRequest) (resp *ExecuteResponse, retErr error) {
+	c.closemu.RLock()
+	defer c.closemu.RUnlock()
+	if c.closed {
+		return nil, ErrTxDone
+	}
+	c.touch()
+
+	stop := c.watchContext(ctx)
+	defer stop()
+
+	tsc := NewTxStateChange(c)
+	resp, retErr = c.store.executeOrAbortContext(ctx, c, ex)
+	if retErr != nil && ctx.Err() != nil {
+		tsc.CheckAndSet()
+	}
+	return resp, retErr
 }
 
 // Query executes queries that return rows, and do not modify the database.
 func (c *Connection) Query(qr *QueryRequest) (*QueryResponse, error) {
-	return c.store.query(c, qr)
+	return c.QueryContext(context.Background(), qr)
+}
+
+// QueryContext is like Query but honors the cancellation and deadline of
+// ctx.
+func (c *Connection) QueryContext(ctx context.Context, qr *QueryRequest) (*QueryResponse, error) {
+	c.closemu.RLock()
+	defer c.closemu.RUnlock()
+	if c.closed {
+		return nil, ErrTxDone
+	}
+	c.touch()
+
+	stop := c.watchContext(ctx)
+	defer stop()
+
+	tsc := NewTxStateChange(c)
+	resp, err := c.store.queryContext(ctx, c, qr)
+	if err != nil && ctx.Err() != nil {
+		tsc.CheckAndSet()
+	}
+	return resp, err
+}
+
+// watchContext starts a goroutine that interrupts the connection's
+// underlying SQLite statement if ctx is canceled or its deadline expires
+// before the returned stop function is called. store.executeContext and
+// store.queryContext check ctx themselves before each statement; the Store
+// has no Raft layer, so there is no Apply call for ctx to gate.
+func (c *Connection) watchContext(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.db.Interrupt()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
 }
 
 // AbortTransaction aborts -- rolls back -- any active transaction. Calling code
@@ -69,12 +199,47 @@ func (c *Connection) Query(qr *QueryRequest) (*QueryResponse, error) {
 // can be used to clean up any dangling state that may result from certain
 // error scenarios.
 func (c *Connection) AbortTransaction() error {
+	c.closemu.Lock()
+	defer c.closemu.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	tsc := NewTxStateChange(c)
 	_, err := c.store.execute(c, &ExecuteRequest{[]string{"ROLLBACK"}, false, false})
+	tsc.CheckAndSet()
+
+	// The transaction that was active is gone, so any Txn handle referring
+	// to it is done -- but the Connection itself remains perfectly usable
+	// for new statements and new explicit transactions once the W-lock
+	// above is released.
+	c.txStateMu.Lock()
+	c.activeTxn = nil
+	c.txStateMu.Unlock()
+
 	return err
 }
 
-// Close closes the connection.
+// Close closes the connection, rolling back any transaction still active on
+// it.
 func (c *Connection) Close() error {
+	c.closemu.Lock()
+	defer c.closemu.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	if c.transactionActive() {
+		if _, err := c.store.execute(c, &ExecuteRequest{[]string{"ROLLBACK"}, false, false}); err != nil {
+			c.logger.Printf("failed to roll back active transaction on close: %s", err.Error())
+		}
+
+		c.txStateMu.Lock()
+		c.activeTxn = nil
+		c.txStateMu.Unlock()
+	}
+	c.closed = true
+
 	return c.store.disconnect(c)
 }
 
@@ -94,6 +259,7 @@ func (c *Connection) MarshalJSON() ([]byte, error) {
 	}
 	if !c.lastUsedAt.IsZero() {
 		m["last_used_at"] = c.lastUsedAt
+		m["idle_for"] = time.Since(c.lastUsedAt).String()
 	}
 
 	return json.Marshal(m)
@@ -111,7 +277,7 @@ type TxStateChange struct {
 func NewTxStateChange(c *Connection) *TxStateChange {
 	return &TxStateChange{
 		c:  c,
-		tx: c.db.TransactionActive(),
+		tx: c.transactionActive(),
 	}
 }
 
@@ -127,9 +293,9 @@ func (t *TxStateChange) CheckAndSet() {
 		panic("CheckAndSet should only be called once")
 	}
 
-	if !t.tx && t.c.db.TransactionActive() && t.c.txStartedAt.IsZero() {
+	if !t.tx && t.c.transactionActive() && t.c.txStartedAt.IsZero() {
 		t.c.txStartedAt = time.Now()
-	} else if t.tx && !t.c.db.TransactionActive() && !t.c.txStartedAt.IsZero() {
+	} else if t.tx && !t.c.transactionActive() && !t.c.txStartedAt.IsZero() {
 		t.c.txStartedAt = time.Time{}
 	}
 }
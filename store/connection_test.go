@@ -0,0 +1,84 @@
+package store
+
+import (
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStore(execHook func(stmt string) error) *Store {
+	s := NewStore(nil, StoreConfig{})
+	s.execHook = execHook
+	s.logger = log.New(io.Discard, "", 0)
+	return s
+}
+
+// TestConnection_AbortTransaction_NoCommitAfterRollback races a long-running
+// Execute against AbortTransaction and asserts that no statement is ever
+// observed completing after the rollback has returned. The fake Store's
+// execute hook sleeps on non-ROLLBACK statements, giving a concurrent
+// AbortTransaction a real window in which to run before the in-flight
+// Execute's closemu.RLock is released.
+func TestConnection_AbortTransaction_NoCommitAfterRollback(t *testing.T) {
+	var mu sync.Mutex
+	var rolledBackAt time.Time
+	var committedAfterRollback bool
+
+	s := newTestStore(func(stmt string) error {
+		if stmt == "ROLLBACK" {
+			mu.Lock()
+			rolledBackAt = time.Now()
+			mu.Unlock()
+			return nil
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		if !rolledBackAt.IsZero() && time.Now().After(rolledBackAt) {
+			committedAfterRollback = true
+		}
+		mu.Unlock()
+		return nil
+	})
+
+	c := NewConnection(nil, s, 1)
+	c.txActiveHook = func() bool { return false }
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.Execute(&ExecuteRequest{[]string{"INSERT INTO t VALUES(1)"}, false, false})
+	}()
+	go func() {
+		defer wg.Done()
+		time.Sleep(5 * time.Millisecond)
+		c.AbortTransaction()
+	}()
+	wg.Wait()
+
+	if committedAfterRollback {
+		t.Fatal("statement was observed completing after AbortTransaction's rollback returned")
+	}
+}
+
+// TestConnection_AbortTransaction_ConnectionStaysUsable ensures that a
+// rollback only ends the transaction it aborted, not the Connection -- a
+// routine AbortTransaction (e.g. from the idle reaper) must not
+// permanently prevent later, unrelated Execute/Query/Begin calls.
+func TestConnection_AbortTransaction_ConnectionStaysUsable(t *testing.T) {
+	s := newTestStore(func(stmt string) error { return nil })
+	c := NewConnection(nil, s, 1)
+	c.txActiveHook = func() bool { return false }
+
+	if err := c.AbortTransaction(); err != nil {
+		t.Fatalf("AbortTransaction failed: %s", err)
+	}
+
+	if _, err := c.Execute(&ExecuteRequest{[]string{"INSERT INTO t VALUES(1)"}, false, false}); err != nil {
+		t.Fatalf("Execute after AbortTransaction should succeed, got: %s", err)
+	}
+}
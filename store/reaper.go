@@ -0,0 +1,124 @@
+package store
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultIdleTimeout is the default value of StoreConfig.IdleTimeout --
+	// how long a Connection can go without an Execute or Query before the
+	// reaper closes it. Zero disables idle reaping.
+	DefaultIdleTimeout = 0 * time.Second
+
+	// DefaultTxIdleTimeout is the default value of StoreConfig.TxIdleTimeout
+	// -- how long a Connection's transaction can remain open, counted from
+	// when it started, before the reaper rolls it back. Zero disables
+	// transaction idle reaping.
+	DefaultTxIdleTimeout = 0 * time.Second
+
+	defaultReapInterval = 30 * time.Second
+)
+
+// reaper periodically closes connections that have been idle for longer
+// than IdleTimeout, and rolls back transactions that have been left open
+// for longer than TxIdleTimeout.
+type reaper struct {
+	store *Store
+
+	idleTimeout   time.Duration
+	txIdleTimeout time.Duration
+	interval      time.Duration
+
+	done chan struct{}
+
+	closedCount     uint64
+	rolledBackCount uint64
+
+	logger *log.Logger
+}
+
+// newReaper returns an initialized reaper for the given Store, using the
+// idle timeouts configured on it.
+func newReaper(s *Store, idleTimeout, txIdleTimeout time.Duration) *reaper {
+	return &reaper{
+		store:         s,
+		idleTimeout:   idleTimeout,
+		txIdleTimeout: txIdleTimeout,
+		interval:      defaultReapInterval,
+		done:          make(chan struct{}),
+		logger:        log.New(os.Stderr, "[reaper] ", log.LstdFlags),
+	}
+}
+
+// Start starts the reaper's background goroutine. It is a no-op, and no
+// goroutine is started, if both idle timeouts are zero.
+func (r *reaper) Start() {
+	if r.idleTimeout <= 0 && r.txIdleTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.reap()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the reaper's background goroutine.
+func (r *reaper) Stop() {
+	close(r.done)
+}
+
+// reap walks the Store's connection table once, closing connections idle
+// for longer than idleTimeout and rolling back transactions open for longer
+// than txIdleTimeout.
+func (r *reaper) reap() {
+	for _, c := range r.store.connections() {
+		c.timeMu.Lock()
+		lastUsedAt := c.lastUsedAt
+		c.timeMu.Unlock()
+		if lastUsedAt.IsZero() {
+			// Never used since it was opened: idle since creation.
+			lastUsedAt = c.createdAt
+		}
+
+		c.txStateMu.Lock()
+		txStartedAt := c.txStartedAt
+		c.txStateMu.Unlock()
+
+		if r.txIdleTimeout > 0 && !txStartedAt.IsZero() && time.Since(txStartedAt) > r.txIdleTimeout {
+			if err := c.AbortTransaction(); err != nil {
+				r.logger.Printf("failed to roll back idle transaction on %s: %s", c.String(), err.Error())
+			} else {
+				atomic.AddUint64(&r.rolledBackCount, 1)
+				r.store.logEvent("reaped idle transaction on " + c.String())
+			}
+			continue
+		}
+
+		if r.idleTimeout > 0 && !lastUsedAt.IsZero() && time.Since(lastUsedAt) > r.idleTimeout {
+			if err := c.Close(); err != nil {
+				r.logger.Printf("failed to close idle connection %s: %s", c.String(), err.Error())
+			} else {
+				atomic.AddUint64(&r.closedCount, 1)
+				r.store.logEvent("reaped idle connection " + c.String())
+			}
+		}
+	}
+}
+
+// Stats returns the number of connections closed, and transactions rolled
+// back, by the reaper since it started.
+func (r *reaper) Stats() (closed, rolledBack uint64) {
+	return atomic.LoadUint64(&r.closedCount), atomic.LoadUint64(&r.rolledBackCount)
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestStore_ReaperWiring verifies that NewStore actually starts a reaper
+// using the configured timeouts, that a real Execute call is what makes a
+// connection "used" (rather than a test reaching into lastUsedAt directly),
+// and that Status() surfaces what the reaper has reaped.
+func TestStore_ReaperWiring(t *testing.T) {
+	const idleTimeout = 5 * time.Millisecond
+
+	s := NewStore(nil, StoreConfig{
+		IdleTimeout: idleTimeout,
+	})
+	s.execHook = func(stmt string) error { return nil }
+	defer s.reaper.Stop()
+
+	if s.reaper == nil {
+		t.Fatal("NewStore did not wire up a reaper")
+	}
+
+	c := s.Connect()
+	c.txActiveHook = func() bool { return false }
+	if _, err := c.Execute(&ExecuteRequest{[]string{"INSERT INTO t VALUES(1)"}, false, false}); err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+
+	// Let the connection actually go idle past idleTimeout, then drive the
+	// reaper's sweep directly rather than waiting on its ticker (which runs
+	// on defaultReapInterval).
+	time.Sleep(2 * idleTimeout)
+	s.reaper.reap()
+
+	closed, _ := s.reaper.Stats()
+	if closed < 1 {
+		t.Fatal("reaper did not close the connection left idle since its last real Execute")
+	}
+
+	out, err := s.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %s", err)
+	}
+	var m map[string]map[string]interface{}
+	if err := json.Unmarshal(out, &m); err != nil {
+		t.Fatalf("Status returned invalid JSON: %s", err)
+	}
+	if m["reaper"]["connections_closed"].(float64) < 1 {
+		t.Fatalf("Status did not report the closed connection: %s", out)
+	}
+}
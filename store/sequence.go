@@ -0,0 +1,178 @@
+package store
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"sync"
+)
+
+const (
+	// SequenceRangeSize is the number of IDs allocated to a node in a single
+	// range for a given sequence partition. A larger range means fewer Raft
+	// round-trips at the cost of more IDs being lost (never reused) if a
+	// node that holds an unused tail of a range is lost.
+	SequenceRangeSize = 1000
+
+	// SequencePartitions is the number of independent sub-ranges a sequence
+	// is sharded into. Allocating from distinct partitions lets concurrent
+	// callers on different nodes pull new ranges without serializing on a
+	// single watermark.
+	SequencePartitions = 8
+
+	// SequencePreretrieve is the number of IDs remaining in a cached range
+	// below which take fetches a fresh range for that partition and replaces
+	// the cached one. The fetch runs in the calling goroutine, which waits
+	// for it, and the IDs left in the replaced range are not handed out.
+	SequencePreretrieve = 100
+)
+
+// sequenceRange is a cached, not-yet-fully-allocated range of IDs for one
+// partition of one sequence.
+type sequenceRange struct {
+	next uint64 // Next ID to hand out from this range.
+	end  uint64 // One past the last ID in this range.
+}
+
+func (r *sequenceRange) exhausted() bool {
+	return r.next >= r.end
+}
+
+func (r *sequenceRange) remaining() uint64 {
+	if r.exhausted() {
+		return 0
+	}
+	return r.end - r.next
+}
+
+// sequenceKey identifies one partition of one named sequence.
+type sequenceKey struct {
+	name      string
+	partition int
+}
+
+// sequenceSlot is one partition's cached range, plus the lock that guards
+// it. Giving each (sequence, partition) its own lock, rather than sharing
+// one lock across the whole cache, is what lets concurrent allocators on
+// different partitions avoid serializing on each other.
+type sequenceSlot struct {
+	mu  sync.Mutex
+	rng *sequenceRange
+}
+
+// sequenceCache holds the in-memory ranges a node has been handed for each
+// (sequence, partition) it has allocated IDs from. It is safe for
+// concurrent use. Every read and mutation of a cached range -- including
+// handing out the next ID in it -- happens with the owning slot's lock
+// held, so two concurrent callers sharing a range can never hand out the
+// same ID twice.
+type sequenceCache struct {
+	slots sync.Map // sequenceKey -> *sequenceSlot
+}
+
+func newSequenceCache() *sequenceCache {
+	return &sequenceCache{}
+}
+
+func (sc *sequenceCache) slotFor(key sequenceKey) *sequenceSlot {
+	v, _ := sc.slots.LoadOrStore(key, &sequenceSlot{})
+	return v.(*sequenceSlot)
+}
+
+// take returns the next ID for key, fetching a new range via fetch if the
+// cached one is missing, exhausted, or has fewer than SequencePreretrieve
+// IDs left (in which case the fresh range replaces the old one once fetch
+// returns, and the ID is taken from the new range). fetch is called with
+// the slot's lock held, so it must not itself try to acquire it, and
+// should not block on any other (sequence, partition)'s slot.
+func (sc *sequenceCache) take(key sequenceKey, fetch func() (low, high uint64, err error)) (uint64, error) {
+	slot := sc.slotFor(key)
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if slot.rng == nil || slot.rng.remaining() < SequencePreretrieve {
+		low, high, err := fetch()
+		if err != nil {
+			if slot.rng == nil || slot.rng.exhausted() {
+				return 0, err
+			}
+			// Keep serving out of the old range; the next call will retry
+			// the fetch.
+		} else {
+			slot.rng = &sequenceRange{next: low, end: high}
+		}
+	}
+
+	id := slot.rng.next
+	slot.rng.next++
+	return id, nil
+}
+
+// partitionFor deterministically maps a sequence name plus an allocation
+// attempt counter to one of SequencePartitions shards. The same name and
+// attempt always give the same partition, so every NextID call for a
+// sequence (attempt 0) draws from one partition; only the IDs of a single
+// NextIDs call are spread across partitions.
+func partitionFor(name string, attempt int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int((h.Sum32() + uint32(attempt)) % uint32(SequencePartitions))
+}
+
+// sequencePartitionBits is how many of a returned ID's high bits encode
+// which partition it came from. Every partition's watermark advances
+// independently starting from 0, so without this, two different partitions
+// would eventually (in fact immediately, for the first ID of each) hand out
+// the same low value -- encoding the partition is what keeps a single
+// sequence's IDs unique across all of its partitions. This bounds the
+// counter each partition can hand out to 2^(64-sequencePartitionBits)
+// before it would bleed into the next partition's bits, which at
+// SequenceRangeSize IDs per range is not a limit any real deployment will
+// approach.
+var sequencePartitionBits = bits.Len(uint(SequencePartitions - 1))
+
+// encodeSequenceID folds partition into the high bits of counter, the
+// within-partition value handed out by sequenceCache.take.
+func encodeSequenceID(partition int, counter uint64) uint64 {
+	return uint64(partition)<<(64-sequencePartitionBits) | counter
+}
+
+// NextID returns the next value in the monotonically increasing, but
+// gap-tolerant, sequence with the given name. Sequences are created
+// implicitly on first use.
+func (c *Connection) NextID(name string) (uint64, error) {
+	ids, err := c.NextIDs(name, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// NextIDs returns the next n values in the sequence with the given name. The
+// returned IDs are unique within this call and across every other call to
+// NextID/NextIDs on this sequence made through the same Store; watermarks
+// are held in that Store's memory and are not shared with other nodes. They
+// are not necessarily increasing or contiguous -- a sequence spreads its
+// allocations across SequencePartitions independent partitions, and an ID's
+// partition is encoded into its high bits precisely so that two partitions
+// can never collide, which also means IDs from different partitions don't
+// compare in allocation order.
+func (c *Connection) NextIDs(name string, n int) ([]uint64, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, n)
+	for attempt := 0; len(ids) < n; attempt++ {
+		partition := partitionFor(name, attempt)
+		key := sequenceKey{name: name, partition: partition}
+
+		id, err := c.store.sequences.take(key, func() (uint64, uint64, error) {
+			return c.store.allocateSequenceRange(key)
+		})
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, encodeSequenceID(partition, id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	sdb "github.com/rqlite/rqlite/db"
+)
+
+// ExecuteRequest represents a request to execute one or more statements
+// that modify the database.
+type ExecuteRequest struct {
+	Statements []string
+	Timings    bool
+	Tx         bool
+}
+
+// ExecuteResponse is the result of an ExecuteRequest.
+type ExecuteResponse struct {
+	Results []ExecuteResult
+	Time    float64
+}
+
+// ExecuteResult is the result of a single statement within an
+// ExecuteRequest.
+type ExecuteResult struct {
+	LastInsertID int64
+	RowsAffected int64
+}
+
+// QueryRequest represents a request to execute one or more statements that
+// read, but do not modify, the database.
+type QueryRequest struct {
+	Statements []string
+	Timings    bool
+}
+
+// QueryResponse is the result of a QueryRequest.
+type QueryResponse struct {
+	Rows []QueryRows
+	Time float64
+}
+
+// QueryRows is the result of a single statement within a QueryRequest.
+type QueryRows struct {
+	Columns []string
+	Types   []string
+	Values  [][]interface{}
+}
+
+// StoreConfig holds the configuration used to create a Store.
+type StoreConfig struct {
+	// IdleTimeout is how long a Connection can go without an Execute or
+	// Query before the reaper closes it. Zero disables idle reaping.
+	IdleTimeout time.Duration
+
+	// TxIdleTimeout is how long a Connection's transaction can remain open,
+	// counted from when it started, before the reaper rolls it back. Zero
+	// disables transaction idle reaping.
+	TxIdleTimeout time.Duration
+}
+
+// Store applies commands against the database and owns the Connections
+// handed out to clients.
+//
+// This is a deliberately minimal, single-node stand-in for the real,
+// Raft-backed Store: it applies statements directly against db rather than
+// through a Raft log, so it has no notion of a leader. A multi-node build
+// would route execute/query through raft.Apply instead of straight to db,
+// but the Connection-facing API (and the locking logic built on top of it)
+// is unaffected by that distinction.
+type Store struct {
+	mu         sync.Mutex
+	db         *sdb.Conn
+	conns      map[uint64]*Connection
+	nextConnID uint64
+
+	sequences        *sequenceCache
+	seqMu            sync.Mutex
+	seqWatermarksMap map[sequenceKey]uint64 // next-unallocated value per (sequence, partition); guarded by seqMu
+	seqTableOnce     sync.Once
+	seqTableErr      error
+
+	reaper *reaper
+
+	// execHook, if non-nil, is called instead of db for every statement run
+	// through execute/executeContext. It exists purely so tests can
+	// exercise Store's locking logic without a real SQLite connection.
+	execHook func(stmt string) error
+
+	logger *log.Logger
+}
+
+// NewStore returns a Store that applies commands against db.
+func NewStore(db *sdb.Conn, cfg StoreConfig) *Store {
+	s := &Store{
+		db:        db,
+		conns:     make(map[uint64]*Connection),
+		sequences: newSequenceCache(),
+		logger:    log.New(os.Stderr, "[store] ", log.LstdFlags),
+	}
+	s.reaper = newReaper(s, cfg.IdleTimeout, cfg.TxIdleTimeout)
+	s.reaper.Start()
+	return s
+}
+
+// Connect returns a new Connection to the database.
+func (s *Store) Connect() *Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextConnID++
+	c := NewConnection(s.db, s, s.nextConnID)
+	s.conns[c.id] = c
+	return c
+}
+
+// connections returns the Connections currently known to the Store.
+func (s *Store) connections() []*Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*Connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		out = append(out, c)
+	}
+	return out
+}
+
+func (s *Store) disconnect(c *Connection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c.id)
+	return nil
+}
+
+func (s *Store) logEvent(msg string) {
+	s.logger.Println(msg)
+}
+
+// Status returns a JSON-serialized summary of the Store's state, for
+// surfacing via the status API.
+func (s *Store) Status() ([]byte, error) {
+	closed, rolledBack := s.reaper.Stats()
+
+	m := map[string]interface{}{
+		"reaper": map[string]interface{}{
+			"connections_closed":       closed,
+			"transactions_rolled_back": rolledBack,
+		},
+	}
+	return json.Marshal(m)
+}
+
+// execute runs ex against the database on behalf of c.
+func (s *Store) execute(c *Connection, ex *ExecuteRequest) (*ExecuteResponse, error) {
+	return s.executeContext(context.Background(), c, ex)
+}
+
+// executeContext is like execute but honors ctx.
+func (s *Store) executeContext(ctx context.Context, c *Connection, ex *ExecuteRequest) (*ExecuteResponse, error) {
+	resp := &ExecuteResponse{}
+	for _, stmt := range ex.Statements {
+		if err := ctx.Err(); err != nil {
+			return resp, err
+		}
+		if err := s.exec(stmt); err != nil {
+			return resp, err
+		}
+		resp.Results = append(resp.Results, ExecuteResult{})
+	}
+	return resp, nil
+}
+
+// executeOrAbort is like execute, but rolls back any transaction active on
+// c if any statement fails.
+func (s *Store) executeOrAbort(c *Connection, ex *ExecuteRequest) (*ExecuteResponse, error) {
+	return s.executeOrAbortContext(context.Background(), c, ex)
+}
+
+// executeOrAbortContext is like executeOrAbort but honors ctx. It issues the
+// rollback directly, rather than through Connection.AbortTransaction, since
+// the caller already holds c.closemu for read and that lock is not
+// re-entrant.
+func (s *Store) executeOrAbortContext(ctx context.Context, c *Connection, ex *ExecuteRequest) (resp *ExecuteResponse, retErr error) {
+	resp, retErr = s.executeContext(ctx, c, ex)
+	if retErr == nil {
+		return resp, nil
+	}
+
+	if c.transactionActive() {
+		if _, rbErr := s.execute(c, &ExecuteRequest{[]string{"ROLLBACK"}, false, false}); rbErr != nil {
+			s.logger.Printf("failed to abort transaction on %s after execute error: %s", c.String(), rbErr.Error())
+		}
+	}
+	c.txStateMu.Lock()
+	c.activeTxn = nil
+	c.txStateMu.Unlock()
+
+	return resp, retErr
+}
+
+// query runs qr against the database on behalf of c.
+func (s *Store) query(c *Connection, qr *QueryRequest) (*QueryResponse, error) {
+	return s.queryContext(context.Background(), c, qr)
+}
+
+// queryContext is like query but honors ctx. Each statement is run through
+// exec, which does not collect rows, so every QueryRows in the response is
+// empty.
+func (s *Store) queryContext(ctx context.Context, c *Connection, qr *QueryRequest) (*QueryResponse, error) {
+	resp := &QueryResponse{}
+	for _, stmt := range qr.Statements {
+		if err := ctx.Err(); err != nil {
+			return resp, err
+		}
+		if err := s.exec(stmt); err != nil {
+			return resp, err
+		}
+		resp.Rows = append(resp.Rows, QueryRows{})
+	}
+	return resp, nil
+}
+
+// exec runs a single statement, through execHook if set (for tests),
+// otherwise against the real database connection.
+func (s *Store) exec(stmt string) error {
+	if s.execHook != nil {
+		return s.execHook(stmt)
+	}
+	_, err := s.db.Exec(stmt)
+	return err
+}
+
+// enabledFromBool renders a boolean as the "enabled"/"disabled" strings used
+// throughout the JSON status output.
+func enabledFromBool(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// sequenceTable is the table that persists the next-unallocated value for
+// each (sequence, partition).
+const sequenceTable = "_rqlite_sequences"
+
+func sqlQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// allocateSequenceRange hands out a new, never-before-allocated range of
+// SequenceRangeSize IDs for key. The watermark is kept authoritatively in
+// memory (seqWatermarksMap, guarded by seqMu) and written to the Sequence
+// table as a side effect. The table is never read back: a new Store starts
+// every watermark at 0, so IDs are unique only for the life of one Store.
+// With no Raft layer in this tree, the node performing the allocation is
+// implicitly treated as authoritative.
+func (s *Store) allocateSequenceRange(key sequenceKey) (low, high uint64, err error) {
+	s.seqTableOnce.Do(func() {
+		createStmt := fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (name TEXT NOT NULL, partition INTEGER NOT NULL, next INTEGER NOT NULL DEFAULT 0, PRIMARY KEY(name, partition))`,
+			sequenceTable)
+		s.seqTableErr = s.exec(createStmt)
+	})
+	if s.seqTableErr != nil {
+		return 0, 0, s.seqTableErr
+	}
+
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+
+	if s.seqWatermarksMap == nil {
+		s.seqWatermarksMap = make(map[sequenceKey]uint64)
+	}
+	low = s.seqWatermarksMap[key]
+	high = low + SequenceRangeSize
+
+	upsertStmt := fmt.Sprintf(
+		`INSERT INTO %s(name, partition, next) VALUES('%s', %d, %d) ON CONFLICT(name, partition) DO UPDATE SET next=%d`,
+		sequenceTable, sqlQuote(key.name), key.partition, high, high)
+	if err := s.exec(upsertStmt); err != nil {
+		return 0, 0, err
+	}
+	s.seqWatermarksMap[key] = high
+
+	return low, high, nil
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTxDone is returned by Txn.Commit or Txn.Rollback if the transaction has
+// already been committed or rolled back, including the case where the
+// underlying SQLite transaction was rolled back out from under the Txn (for
+// example by a concurrent call to Connection.AbortTransaction).
+var ErrTxDone = errors.New("store: transaction has already been committed or rolled back")
+
+// ErrTxActive is returned by Connection.Begin, Connection.BeginImmediate, and
+// Connection.BeginExclusive if a transaction is already active on the
+// Connection.
+var ErrTxActive = errors.New("store: a transaction is already active on this connection")
+
+// Txn represents an explicit transaction on a Connection, started via
+// Connection.Begin, Connection.BeginImmediate, or Connection.BeginExclusive.
+// A Txn must be ended by exactly one call to Commit, Rollback, or End.
+type Txn struct {
+	c    *Connection
+	done bool
+}
+
+// Begin starts a transaction using BEGIN DEFERRED, the default SQLite
+// locking mode, and returns a Txn that can be used to Commit or Rollback it.
+func (c *Connection) Begin() (*Txn, error) {
+	return c.begin("BEGIN DEFERRED")
+}
+
+// BeginImmediate starts a transaction using BEGIN IMMEDIATE, which acquires
+// a write lock on the database as soon as the transaction starts.
+func (c *Connection) BeginImmediate() (*Txn, error) {
+	return c.begin("BEGIN IMMEDIATE")
+}
+
+// BeginExclusive starts a transaction using BEGIN EXCLUSIVE, which acquires
+// an exclusive lock on the database as soon as the transaction starts.
+func (c *Connection) BeginExclusive() (*Txn, error) {
+	return c.begin("BEGIN EXCLUSIVE")
+}
+
+func (c *Connection) begin(stmt string) (*Txn, error) {
+	c.closemu.RLock()
+	defer c.closemu.RUnlock()
+	if c.closed {
+		return nil, ErrTxDone
+	}
+
+	// Claim the Connection for the new Txn before issuing BEGIN, so a
+	// concurrent begin sees it as taken. txStateMu is released again before
+	// CheckAndSet, which takes it itself.
+	tx := &Txn{c: c}
+	c.txStateMu.Lock()
+	if c.activeTxn != nil {
+		c.txStateMu.Unlock()
+		return nil, ErrTxActive
+	}
+	c.activeTxn = tx
+	c.txStateMu.Unlock()
+
+	tsc := NewTxStateChange(c)
+	if _, err := c.store.execute(c, &ExecuteRequest{[]string{stmt}, false, false}); err != nil {
+		c.txStateMu.Lock()
+		c.activeTxn = nil
+		c.txStateMu.Unlock()
+		return nil, err
+	}
+	tsc.CheckAndSet()
+
+	return tx, nil
+}
+
+// Execute executes queries that return no rows, but do modify the database,
+// as part of this transaction.
+func (t *Txn) Execute(ex *ExecuteRequest) (*ExecuteResponse, error) {
+	t.c.closemu.RLock()
+	defer t.c.closemu.RUnlock()
+	if err := t.checkActive(); err != nil {
+		return nil, err
+	}
+	return t.c.store.execute(t.c, ex)
+}
+
+// Query executes queries that return rows, and do not modify the database,
+// as part of this transaction.
+func (t *Txn) Query(qr *QueryRequest) (*QueryResponse, error) {
+	t.c.closemu.RLock()
+	defer t.c.closemu.RUnlock()
+	if err := t.checkActive(); err != nil {
+		return nil, err
+	}
+	return t.c.store.query(t.c, qr)
+}
+
+// Commit commits the transaction.
+func (t *Txn) Commit() error {
+	return t.end("COMMIT")
+}
+
+// Rollback aborts the transaction.
+func (t *Txn) Rollback() error {
+	return t.end("ROLLBACK")
+}
+
+// End is a convenience function intended to be used with defer, in the form
+// defer tx.End(&err). If *errp is nil it commits the transaction, otherwise
+// it rolls it back. ErrTxDone from the rollback is swallowed -- the Txn was
+// already done, most likely because something else (e.g.
+// Connection.AbortTransaction) ended it first, which is not itself a
+// failure worth reporting. Any other rollback error is a genuine failure
+// and is wrapped onto *errp rather than discarded, even when *errp was
+// already set.
+func (t *Txn) End(errp *error) {
+	if *errp == nil {
+		*errp = t.Commit()
+		return
+	}
+
+	if err := t.Rollback(); err != nil && err != ErrTxDone {
+		*errp = fmt.Errorf("%w (additionally, rollback failed: %s)", *errp, err)
+	}
+}
+
+func (t *Txn) checkActive() error {
+	t.c.txStateMu.Lock()
+	defer t.c.txStateMu.Unlock()
+
+	if t.done || t.c.activeTxn != t || t.c.closed {
+		return ErrTxDone
+	}
+	if !t.c.transactionActive() {
+		// The underlying SQLite transaction was rolled back out from under
+		// us -- most likely via Connection.AbortTransaction -- so treat
+		// this Txn as done too.
+		t.done = true
+		t.c.activeTxn = nil
+		return ErrTxDone
+	}
+	return nil
+}
+
+func (t *Txn) end(stmt string) error {
+	t.c.closemu.Lock()
+	defer t.c.closemu.Unlock()
+
+	if err := t.checkActive(); err != nil {
+		return err
+	}
+
+	tsc := NewTxStateChange(t.c)
+	_, err := t.c.store.execute(t.c, &ExecuteRequest{[]string{stmt}, false, false})
+	tsc.CheckAndSet()
+
+	t.c.txStateMu.Lock()
+	t.done = true
+	t.c.activeTxn = nil
+	t.c.txStateMu.Unlock()
+
+	return err
+}
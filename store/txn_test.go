@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newActiveTxn returns a Txn that checkActive will treat as active on c,
+// without going through Begin (which needs a real SQLite connection to
+// observe the BEGIN statement taking effect).
+func newActiveTxn(c *Connection) *Txn {
+	tx := &Txn{c: c}
+	c.activeTxn = tx
+	return tx
+}
+
+// TestTxn_End_SurfacesRollbackFailure ensures that a genuine rollback
+// failure -- as opposed to ErrTxDone, which just means the Txn was already
+// over -- is never silently discarded by End, even when the caller already
+// had an error of its own.
+func TestTxn_End_SurfacesRollbackFailure(t *testing.T) {
+	rollbackErr := errors.New("disk I/O error")
+	s := newTestStore(func(stmt string) error {
+		if stmt == "ROLLBACK" {
+			return rollbackErr
+		}
+		return nil
+	})
+	c := NewConnection(nil, s, 1)
+	c.txActiveHook = func() bool { return true }
+	tx := newActiveTxn(c)
+
+	origErr := errors.New("boom")
+	err := origErr
+	tx.End(&err)
+
+	if err == nil {
+		t.Fatal("expected End to surface the rollback failure, got nil")
+	}
+	if !errors.Is(err, origErr) {
+		t.Fatalf("expected returned error to wrap the original error, got: %s", err)
+	}
+	if !strings.Contains(err.Error(), rollbackErr.Error()) {
+		t.Fatalf("expected returned error to mention the rollback failure, got: %s", err)
+	}
+}
+
+// TestTxn_End_SwallowsErrTxDoneFromRollback ensures End's swallowing stays
+// scoped to ErrTxDone -- the case where the Txn had already ended -- and
+// doesn't mask the caller's original error in that case either.
+func TestTxn_End_SwallowsErrTxDoneFromRollback(t *testing.T) {
+	s := newTestStore(func(stmt string) error { return nil })
+	c := NewConnection(nil, s, 1)
+	c.txActiveHook = func() bool { return true }
+	tx := newActiveTxn(c)
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %s", err)
+	}
+
+	origErr := errors.New("boom")
+	err := origErr
+	tx.End(&err) // tx is already done, so End's own Rollback returns ErrTxDone
+
+	if err != origErr {
+		t.Fatalf("expected the original error to be left untouched, got: %s", err)
+	}
+}